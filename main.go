@@ -1,11 +1,14 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pion/stun/v3"
@@ -41,113 +44,248 @@ func (t RequestedTransport) AddTo(m *stun.Message) error {
 }
 
 type AmplificationResult struct {
-	RequestSize         uint32
-	ResponseSize        uint32
-	AmplificationFactor float64
-	ResponseType        string
-	HasNonce            bool
-	NonceSize           int
+	RequestSize         uint32        `json:"request_size"`
+	ResponseSize        uint32        `json:"response_size"`
+	AmplificationFactor float64       `json:"amplification_factor"`
+	ResponseType        string        `json:"response_type,omitempty"`
+	HasNonce            bool          `json:"has_nonce"`
+	NonceSize           int           `json:"nonce_size,omitempty"`
+	Latency             time.Duration `json:"latency_ns"`
+	// Steps holds the per-stage breakdown when the full authenticated
+	// allocation lifecycle was measured (see runAuthenticatedFlow); it is
+	// nil for plain unauthenticated Allocate probes.
+	Steps []StepResult `json:"steps,omitempty"`
+	// Probe names which Prober produced this result (see probes.go); it is
+	// empty for the authenticated lifecycle, which isn't probe-selectable.
+	Probe string `json:"probe,omitempty"`
+}
+
+// Config bundles the measurement parameters gathered from the CLI flags.
+type Config struct {
+	Server            string
+	Count             int
+	Workers           int
+	Transport         Transport
+	User              string
+	Pass              string
+	Realm             string
+	Output            string
+	OutputFile        string
+	MetricsAddr       string
+	Probe             string
+	Targets           string
+	TargetConcurrency int
+	ProbeTimeout      time.Duration
 }
 
 func main() {
 	var (
-		server = flag.String("server", "127.0.0.1:3478", "TURN server address")
-		count  = flag.Int("count", 100, "Number of requests to send")
+		server            = flag.String("server", "127.0.0.1:3478", "TURN server address")
+		count             = flag.Int("count", 100, "Number of requests to send")
+		workers           = flag.Int("workers", 1, "Number of concurrent workers sending requests")
+		transport         = flag.String("transport", "udp", "Transport to use: udp, tcp or tls")
+		user              = flag.String("user", "", "Username for the long-term credential mechanism (enables the full authenticated allocation lifecycle)")
+		pass              = flag.String("pass", "", "Password for the long-term credential mechanism")
+		realm             = flag.String("realm", "", "Realm for the long-term credential mechanism (falls back to the server-advertised realm)")
+		output            = flag.String("output", "text", "Output format: text, json or prom")
+		outputFile        = flag.String("output-file", "", "Write a textfile-collector-compatible .prom file here (output=prom only)")
+		metricsAddr       = flag.String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090 (output=prom only)")
+		probe             = flag.String("probe", "allocate-udp", "Comma-separated probes to run (unauthenticated mode only): "+strings.Join(probeNames(), ", "))
+		targets           = flag.String("targets", "", "Path to a file of host:port targets (optionally 'host:port proto=udp|tcp|tls' per line), one per line; overrides -server and -transport")
+		targetConcurrency = flag.Int("target-concurrency", 10, "Number of targets to probe in parallel (-targets only)")
+		probeTimeout      = flag.Duration("probe-timeout", 3*time.Second, "Read timeout for a probe's response, so an unresponsive target is reported rather than hanging forever")
 	)
 	flag.Parse()
 
-	fmt.Printf("TURN Amplification Factor Measurement Tool\n")
-	fmt.Printf("==========================================\n")
-	fmt.Printf("Target server: %s\n", *server)
-	fmt.Printf("Request count: %d\n", *count)
-
-	results, err := measureAmplificationFactor(*server, *count)
-	if err != nil {
-		log.Fatalf("Failed to measure amplification factor: %v", err)
+	cfg := Config{
+		Server:            *server,
+		Count:             *count,
+		Workers:           *workers,
+		Transport:         Transport(*transport),
+		User:              *user,
+		Pass:              *pass,
+		Realm:             *realm,
+		Output:            *output,
+		OutputFile:        *outputFile,
+		MetricsAddr:       *metricsAddr,
+		Probe:             *probe,
+		Targets:           *targets,
+		TargetConcurrency: *targetConcurrency,
+		ProbeTimeout:      *probeTimeout,
 	}
 
-	printResults(results)
-}
+	if cfg.Targets != "" {
+		if cfg.Output == "text" {
+			fmt.Printf("TURN Amplification Factor Measurement Tool\n")
+			fmt.Printf("==========================================\n")
+			fmt.Printf("Targets file:  %s\n", cfg.Targets)
+			fmt.Printf("Concurrency:   %d\n", cfg.TargetConcurrency)
+			fmt.Printf("Request count: %d (per target)\n", cfg.Count)
+		}
+		if err := runTargetScan(cfg); err != nil {
+			log.Fatalf("Failed to scan targets: %v", err)
+		}
+		return
+	}
 
-func measureAmplificationFactor(serverAddr string, count int) ([]AmplificationResult, error) {
-	// Resolve server address
-	addr, err := net.ResolveUDPAddr("udp", serverAddr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve server address: %w", err)
+	if cfg.Output == "text" {
+		fmt.Printf("TURN Amplification Factor Measurement Tool\n")
+		fmt.Printf("==========================================\n")
+		fmt.Printf("Target server: %s\n", cfg.Server)
+		fmt.Printf("Transport:     %s\n", cfg.Transport)
+		fmt.Printf("Request count: %d\n", cfg.Count)
+		fmt.Printf("Workers:       %d\n", cfg.Workers)
+		if cfg.User != "" {
+			fmt.Printf("Auth mode:     full allocation lifecycle (user %q)\n", cfg.User)
+		} else {
+			fmt.Printf("Probes:        %s\n", cfg.Probe)
+		}
 	}
 
-	// Create UDP connection
-	// TURN client won't create a local listening socket by itself.
-	conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+	results, partialSteps, attempted, elapsed, failures, err := measureAmplificationFactor(cfg)
 	if err != nil {
-		log.Panicf("Failed to listen: %s", err)
+		log.Fatalf("Failed to measure amplification factor: %v", err)
 	}
-	defer conn.Close()
-
-	var results []AmplificationResult
 
-	for i := 0; i < count; i++ {
-		result, err := sendAllocateRequest(conn, addr)
-		if err != nil {
-			fmt.Printf("Request %d failed: %v\n", i+1, err)
-			continue
+	switch cfg.Output {
+	case "json":
+		if err := writeJSONResults(os.Stdout, results, attempted, elapsed, failures); err != nil {
+			log.Fatalf("Failed to write JSON output: %v", err)
 		}
-
-		results = append(results, result)
-
-		time.Sleep(10 * time.Millisecond)
+	case "prom":
+		if err := writePromOutput(cfg, results, attempted); err != nil {
+			log.Fatalf("Failed to write Prometheus output: %v", err)
+		}
+	default:
+		printResults(results, partialSteps, attempted, elapsed, failures)
 	}
-
-	return results, nil
 }
 
-func sendAllocateRequest(conn net.PacketConn, to net.Addr) (AmplificationResult, error) {
-	var result AmplificationResult
-
-	// Build allocation request message
-	msg, err := stun.Build(
-		stun.TransactionID,
-		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
-		RequestedTransport{Protocol: ProtoUDP},
-		stun.Fingerprint,
-	)
-	if err != nil {
-		return result, fmt.Errorf("failed to build request: %w", err)
+// measureAmplificationFactor returns successful results plus, separately,
+// partialSteps: authenticated-flow attempts that failed partway through a
+// later stage but still measured earlier stages. partialSteps is counted in
+// failures, not results, and exists only so printStepBreakdown can still
+// show which stage is the worst offender.
+func measureAmplificationFactor(cfg Config) ([]AmplificationResult, []AmplificationResult, int, time.Duration, map[FailureMode]int, error) {
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
 	}
 
-	result.RequestSize = stunHeaderSize + msg.Length
-
-	_, err = conn.WriteTo(msg.Raw, to)
+	probes, err := parseProbes(cfg.Probe)
 	if err != nil {
-		return AmplificationResult{}, err
+		return nil, nil, 0, 0, nil, err
 	}
 
-	//
-	res := make([]byte, 2048)
-	if _, _, err := conn.ReadFrom(res); err != nil {
-		return AmplificationResult{}, err
+	// Split the total request count across the workers as evenly as possible.
+	perWorker := make([]int, workers)
+	for i := 0; i < cfg.Count; i++ {
+		perWorker[i%workers]++
 	}
 
-	// Check for NONCE attribute
-	msg = stun.New()
-	if err := stun.Decode(res, msg); err != nil {
-		return AmplificationResult{}, err
-	}
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		results      []AmplificationResult
+		partialSteps []AmplificationResult
+		failures     = map[FailureMode]int{}
+	)
 
-	if msg.Type.Class != stun.ClassErrorResponse || msg.Type.Method != stun.MethodAllocate {
-		return AmplificationResult{}, errors.New("unexpected response")
-	}
+	start := time.Now()
 
-	result.ResponseSize = stunHeaderSize + msg.Length
-	result.AmplificationFactor = float64(result.ResponseSize) / float64(result.RequestSize)
+	for w := 0; w < workers; w++ {
+		n := perWorker[w]
+		if n == 0 {
+			continue
+		}
 
-	var nonce stun.Nonce
-	if err := nonce.GetFrom(msg); err == nil {
-		result.HasNonce = true
-		result.NonceSize = len(nonce)
+		wg.Add(1)
+		go func(worker, n int) {
+			defer wg.Done()
+
+			// Unauthenticated probes don't allocate any server-side state, so
+			// one connection can serve every iteration. The authenticated
+			// lifecycle does allocate a relay, and a TURN server only permits
+			// one allocation per client 5-tuple (RFC 5766 Section 5), so each
+			// of its iterations opens its own connection instead.
+			var conn net.PacketConn
+			var addr net.Addr
+			var err error
+			if cfg.User == "" {
+				conn, addr, err = dialTransport(cfg.Transport, cfg.Server)
+				if err != nil {
+					mode := classifyFailure(err)
+					log.Printf("Worker %d: %v", worker, err)
+					mu.Lock()
+					failures[mode] += n
+					mu.Unlock()
+					return
+				}
+				defer conn.Close()
+			}
+
+			for i := 0; i < n; i++ {
+				reqStart := time.Now()
+
+				var (
+					result AmplificationResult
+					err    error
+				)
+				if cfg.User != "" {
+					authConn, authAddr, dialErr := dialTransport(cfg.Transport, cfg.Server)
+					if dialErr != nil {
+						mode := classifyFailure(dialErr)
+						fmt.Printf("Worker %d request %d failed (%s): %v\n", worker, i+1, mode, dialErr)
+						mu.Lock()
+						failures[mode]++
+						mu.Unlock()
+						continue
+					}
+					result, err = runAuthenticatedRequest(authConn, authAddr, cfg.User, cfg.Pass, cfg.Realm, cfg.ProbeTimeout)
+					authConn.Close()
+				} else {
+					np := probes[i%len(probes)]
+					result, err = runProbe(conn, addr, np.Prober, cfg.ProbeTimeout)
+					result.Probe = np.Name
+				}
+				if err != nil {
+					mode := classifyFailure(err)
+					fmt.Printf("Worker %d request %d failed (%s): %v\n", worker, i+1, mode, err)
+					mu.Lock()
+					failures[mode]++
+					mu.Unlock()
+
+					// The authenticated lifecycle can fail partway
+					// through a later stage (e.g. a server that
+					// doesn't support ChannelBind) while still having
+					// measured earlier stages successfully; keep that
+					// partial Steps data for printStepBreakdown, but the
+					// request itself still failed, so it doesn't belong
+					// in results.
+					if len(result.Steps) > 0 {
+						result.Latency = time.Since(reqStart)
+						mu.Lock()
+						partialSteps = append(partialSteps, result)
+						mu.Unlock()
+					}
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+				result.Latency = time.Since(reqStart)
+
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+			}
+		}(w, n)
 	}
 
-	return result, nil
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	return results, partialSteps, cfg.Count, elapsed, failures, nil
 }
 
 func getErrorCode(msg *stun.Message) stun.ErrorCode {
@@ -158,9 +296,10 @@ func getErrorCode(msg *stun.Message) stun.ErrorCode {
 	return 0
 }
 
-func printResults(results []AmplificationResult) {
+func printResults(results, partialSteps []AmplificationResult, attempted int, elapsed time.Duration, failures map[FailureMode]int) {
 	if len(results) == 0 {
 		fmt.Println("No successful results to analyze.")
+		printFailureBreakdown(failures)
 		return
 	}
 
@@ -187,4 +326,185 @@ func printResults(results []AmplificationResult) {
 	fmt.Printf("Average Request Size:     %.1f bytes\n", avgReqSize)
 	fmt.Printf("Average Response Size:    %.1f bytes\n", avgRespSize)
 	fmt.Printf("Overall Amplification:    %.2fx\n", avgAmp)
+
+	printLoadStats(results, attempted, elapsed)
+	printStepBreakdown(results, partialSteps)
+	printProbeBreakdown(results)
+	printFailureBreakdown(failures)
+}
+
+// printFailureBreakdown reports how requests that never produced a result
+// failed, by failure mode (timeout, unreachable, malformed, ...), instead of
+// only the aggregate packet-loss percentage already in Load Statistics.
+func printFailureBreakdown(failures map[FailureMode]int) {
+	if len(failures) == 0 {
+		return
+	}
+
+	modes := make([]string, 0, len(failures))
+	for mode := range failures {
+		modes = append(modes, string(mode))
+	}
+	sort.Strings(modes)
+
+	fmt.Printf("\nFailure Modes:\n")
+	fmt.Printf("==============\n")
+	for _, mode := range modes {
+		fmt.Printf("%-15s %d\n", mode, failures[FailureMode(mode)])
+	}
+}
+
+// printProbeBreakdown reports average amplification per probe, when more
+// than one -probe was selected.
+func printProbeBreakdown(results []AmplificationResult) {
+	type probeStats struct {
+		totalAmp float64
+		count    int
+	}
+
+	order := []string{}
+	stats := map[string]*probeStats{}
+
+	for _, res := range results {
+		if res.Probe == "" {
+			continue
+		}
+		s, ok := stats[res.Probe]
+		if !ok {
+			s = &probeStats{}
+			stats[res.Probe] = s
+			order = append(order, res.Probe)
+		}
+		s.totalAmp += res.AmplificationFactor
+		s.count++
+	}
+
+	if len(order) < 2 {
+		return
+	}
+
+	fmt.Printf("\nPer-Probe Amplification:\n")
+	fmt.Printf("=========================\n")
+	for _, name := range order {
+		s := stats[name]
+		fmt.Printf("%-28s avg amplification %.2fx (%d samples)\n", name, s.totalAmp/float64(s.count), s.count)
+	}
+}
+
+// printStepBreakdown reports average amplification per stage of the TURN
+// allocation lifecycle, when the authenticated flow was used, so users can
+// see which stage of the dialog offers the worst amplification. partialSteps
+// carries attempts that failed partway through the dialog; they're folded in
+// here for step coverage even though they're not in results.
+func printStepBreakdown(results, partialSteps []AmplificationResult) {
+	type stepStats struct {
+		totalAmp float64
+		count    int
+	}
+
+	order := []string{}
+	stats := map[string]*stepStats{}
+
+	allAttempts := make([]AmplificationResult, 0, len(results)+len(partialSteps))
+	allAttempts = append(allAttempts, results...)
+	allAttempts = append(allAttempts, partialSteps...)
+
+	for _, res := range allAttempts {
+		for _, step := range res.Steps {
+			s, ok := stats[step.Step]
+			if !ok {
+				s = &stepStats{}
+				stats[step.Step] = s
+				order = append(order, step.Step)
+			}
+			s.totalAmp += step.AmplificationFactor
+			s.count++
+		}
+	}
+
+	if len(order) == 0 {
+		return
+	}
+
+	fmt.Printf("\nPer-Stage Amplification (authenticated lifecycle):\n")
+	fmt.Printf("====================================================\n")
+	for _, name := range order {
+		s := stats[name]
+		if s.count == 0 {
+			continue
+		}
+		fmt.Printf("%-20s avg amplification %.2fx (%d samples)\n", name, s.totalAmp/float64(s.count), s.count)
+	}
+}
+
+// printLoadStats reports latency percentiles, throughput and loss, and
+// correlates latency with amplification so that users can tell whether
+// larger responses coincide with slower server processing.
+func printLoadStats(results []AmplificationResult, attempted int, elapsed time.Duration) {
+	latencies := make([]time.Duration, len(results))
+	var totalLatency time.Duration
+	for i, res := range results {
+		latencies[i] = res.Latency
+		totalLatency += res.Latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	p50 := percentile(latencies, 50)
+	p90 := percentile(latencies, 90)
+	p99 := percentile(latencies, 99)
+	max := latencies[len(latencies)-1]
+
+	lossRate := float64(attempted-len(results)) / float64(attempted) * 100
+	rps := float64(len(results)) / elapsed.Seconds()
+
+	fmt.Printf("\nLoad Statistics:\n")
+	fmt.Printf("================\n")
+	fmt.Printf("Requests/sec:             %.1f\n", rps)
+	fmt.Printf("Packet loss:              %.1f%% (%d/%d)\n", lossRate, attempted-len(results), attempted)
+	fmt.Printf("Latency p50:              %s\n", p50)
+	fmt.Printf("Latency p90:              %s\n", p90)
+	fmt.Printf("Latency p99:              %s\n", p99)
+	fmt.Printf("Latency max:              %s\n", max)
+	fmt.Printf("Latency avg:              %s\n", totalLatency/time.Duration(len(results)))
+
+	// Correlation: average latency for requests above vs at/below the
+	// overall average amplification factor.
+	var avgAmp float64
+	for _, res := range results {
+		avgAmp += res.AmplificationFactor
+	}
+	avgAmp /= float64(len(results))
+
+	var highAmpLatency, lowAmpLatency time.Duration
+	var highCount, lowCount int
+	for _, res := range results {
+		if res.AmplificationFactor > avgAmp {
+			highAmpLatency += res.Latency
+			highCount++
+		} else {
+			lowAmpLatency += res.Latency
+			lowCount++
+		}
+	}
+
+	fmt.Printf("\nLatency vs. amplification (split at avg %.2fx):\n", avgAmp)
+	if highCount > 0 {
+		fmt.Printf("  Above-average amplification (%d reqs): avg latency %s\n", highCount, highAmpLatency/time.Duration(highCount))
+	}
+	if lowCount > 0 {
+		fmt.Printf("  At/below-average amplification (%d reqs): avg latency %s\n", lowCount, lowAmpLatency/time.Duration(lowCount))
+	}
+}
+
+// percentile returns the p-th percentile (0-100) of a pre-sorted duration
+// slice using nearest-rank interpolation.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p/100*float64(len(sorted)-1) + 0.5)
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(vals ...int) []time.Duration {
+		out := make([]time.Duration, len(vals))
+		for i, v := range vals {
+			out[i] = time.Duration(v) * time.Millisecond
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"single", ms(10), 50, 10 * time.Millisecond},
+		{"p50 odd count", ms(1, 2, 3, 4, 5), 50, 3 * time.Millisecond},
+		{"p0 is min", ms(1, 2, 3, 4, 5), 0, 1 * time.Millisecond},
+		{"p100 is max", ms(1, 2, 3, 4, 5), 100, 5 * time.Millisecond},
+		{"p99 clamps to last", ms(1, 2, 3), 99, 3 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := percentile(tt.sorted, tt.p)
+			if got != tt.want {
+				t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+			}
+		})
+	}
+}
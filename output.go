@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// Summary is the machine-readable counterpart of the banner printed by
+// printResults: the same aggregate numbers, shaped for json.Marshal.
+type Summary struct {
+	SuccessfulRequests int            `json:"successful_requests"`
+	AttemptedRequests  int            `json:"attempted_requests"`
+	AvgRequestSize     float64        `json:"avg_request_size_bytes"`
+	AvgResponseSize    float64        `json:"avg_response_size_bytes"`
+	AvgAmplification   float64        `json:"avg_amplification_factor"`
+	RequestsPerSec     float64        `json:"requests_per_sec"`
+	PacketLossPercent  float64        `json:"packet_loss_percent"`
+	LatencyP50Ms       float64        `json:"latency_p50_ms"`
+	LatencyP90Ms       float64        `json:"latency_p90_ms"`
+	LatencyP99Ms       float64        `json:"latency_p99_ms"`
+	LatencyMaxMs       float64        `json:"latency_max_ms"`
+	Failures           map[string]int `json:"failures,omitempty"`
+}
+
+func computeSummary(results []AmplificationResult, attempted int, elapsed time.Duration, failures map[FailureMode]int) Summary {
+	failureCounts := make(map[string]int, len(failures))
+	for mode, count := range failures {
+		failureCounts[string(mode)] = count
+	}
+
+	if len(results) == 0 {
+		return Summary{AttemptedRequests: attempted, Failures: failureCounts}
+	}
+
+	var totalAmp float64
+	var totalReqSize, totalRespSize uint32
+	latencies := make([]time.Duration, len(results))
+	for i, res := range results {
+		totalAmp += res.AmplificationFactor
+		totalReqSize += res.RequestSize
+		totalRespSize += res.ResponseSize
+		latencies[i] = res.Latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	n := float64(len(results))
+
+	return Summary{
+		SuccessfulRequests: len(results),
+		AttemptedRequests:  attempted,
+		AvgRequestSize:     float64(totalReqSize) / n,
+		AvgResponseSize:    float64(totalRespSize) / n,
+		AvgAmplification:   totalAmp / n,
+		RequestsPerSec:     n / elapsed.Seconds(),
+		PacketLossPercent:  float64(attempted-len(results)) / float64(attempted) * 100,
+		LatencyP50Ms:       percentile(latencies, 50).Seconds() * 1000,
+		LatencyP90Ms:       percentile(latencies, 90).Seconds() * 1000,
+		LatencyP99Ms:       percentile(latencies, 99).Seconds() * 1000,
+		LatencyMaxMs:       latencies[len(latencies)-1].Seconds() * 1000,
+		Failures:           failureCounts,
+	}
+}
+
+// writeJSONResults prints one AmplificationResult per line followed by a
+// trailing summary object, so the output composes with jq and log
+// pipelines (e.g. `... -output json | jq 'select(.amplification_factor >
+// 10)'`).
+func writeJSONResults(w io.Writer, results []AmplificationResult, attempted int, elapsed time.Duration, failures map[FailureMode]int) error {
+	enc := json.NewEncoder(w)
+
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+
+	return enc.Encode(computeSummary(results, attempted, elapsed, failures))
+}
+
+// writePromOutput renders the measurement as a Prometheus text-exposition
+// payload and either writes it to a textfile-collector file or serves it
+// over HTTP, per cfg.OutputFile / cfg.MetricsAddr.
+func writePromOutput(cfg Config, results []AmplificationResult, attempted int) error {
+	body := buildPromText(results, attempted)
+
+	switch {
+	case cfg.MetricsAddr != "":
+		http.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			_, _ = w.Write(body)
+		})
+		fmt.Printf("Serving Prometheus metrics on http://%s/metrics\n", cfg.MetricsAddr)
+		return http.ListenAndServe(cfg.MetricsAddr, nil)
+
+	case cfg.OutputFile != "":
+		return os.WriteFile(cfg.OutputFile, body, 0o644)
+
+	default:
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+}
+
+var (
+	amplificationBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+	responseSizeBuckets  = []float64{64, 128, 256, 512, 1024, 2048, 4096, 8192}
+	nonceSizeBuckets     = []float64{0, 8, 16, 32, 64, 128}
+)
+
+// buildPromText renders turn_amplification_factor, turn_response_size_bytes
+// and turn_nonce_size_bytes as histograms plus turn_request_total as a
+// counter, so operators can alert when a TURN server's amplification
+// crosses a threshold instead of eyeballing stdout.
+func buildPromText(results []AmplificationResult, attempted int) []byte {
+	var b []byte
+	buf := func(format string, args ...any) {
+		b = append(b, []byte(fmt.Sprintf(format, args...))...)
+	}
+
+	amps := make([]float64, len(results))
+	respSizes := make([]float64, len(results))
+	nonceSizes := make([]float64, 0, len(results))
+	for i, res := range results {
+		amps[i] = res.AmplificationFactor
+		respSizes[i] = float64(res.ResponseSize)
+		if res.HasNonce {
+			nonceSizes = append(nonceSizes, float64(res.NonceSize))
+		}
+	}
+
+	buf("# HELP turn_amplification_factor Response-to-request size ratio for TURN probes.\n")
+	buf("# TYPE turn_amplification_factor histogram\n")
+	buf(histogramText("turn_amplification_factor", amps, amplificationBuckets))
+
+	buf("# HELP turn_response_size_bytes Size of TURN server responses in bytes.\n")
+	buf("# TYPE turn_response_size_bytes histogram\n")
+	buf(histogramText("turn_response_size_bytes", respSizes, responseSizeBuckets))
+
+	buf("# HELP turn_nonce_size_bytes Size of the NONCE attribute returned by the server.\n")
+	buf("# TYPE turn_nonce_size_bytes histogram\n")
+	buf(histogramText("turn_nonce_size_bytes", nonceSizes, nonceSizeBuckets))
+
+	buf("# HELP turn_request_total Total number of TURN probe requests sent.\n")
+	buf("# TYPE turn_request_total counter\n")
+	buf("turn_request_total{status=\"success\"} %d\n", len(results))
+	buf("turn_request_total{status=\"failure\"} %d\n", attempted-len(results))
+
+	return b
+}
+
+// histogramText renders one Prometheus histogram in text-exposition format:
+// cumulative bucket counts, the +Inf bucket, and the _sum/_count lines.
+func histogramText(name string, values []float64, buckets []float64) string {
+	counts := make([]int, len(buckets))
+	var sum float64
+	for _, v := range values {
+		sum += v
+		for i, le := range buckets {
+			if v <= le {
+				counts[i]++
+			}
+		}
+	}
+
+	var out string
+	for i, le := range buckets {
+		out += fmt.Sprintf("%s_bucket{le=\"%s\"} %d\n", name, formatBucketBound(le), counts[i])
+	}
+	out += fmt.Sprintf("%s_bucket{le=\"+Inf\"} %d\n", name, len(values))
+	out += fmt.Sprintf("%s_sum %g\n", name, sum)
+	out += fmt.Sprintf("%s_count %d\n", name, len(values))
+
+	return out
+}
+
+func formatBucketBound(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramText(t *testing.T) {
+	buckets := []float64{1, 2, 5}
+
+	tests := []struct {
+		name         string
+		values       []float64
+		wantCounts   []string // one "le=\"...\" N" fragment per bucket, in order
+		wantSum      string
+		wantCount    string
+		wantInfCount string
+	}{
+		{
+			name:         "empty",
+			values:       nil,
+			wantCounts:   []string{`le="1"} 0`, `le="2"} 0`, `le="5"} 0`},
+			wantSum:      "turn_x_sum 0\n",
+			wantCount:    "turn_x_count 0\n",
+			wantInfCount: `le="+Inf"} 0`,
+		},
+		{
+			name:         "values on bucket boundaries are inclusive",
+			values:       []float64{1, 2, 5},
+			wantCounts:   []string{`le="1"} 1`, `le="2"} 2`, `le="5"} 3`},
+			wantSum:      "turn_x_sum 8\n",
+			wantCount:    "turn_x_count 3\n",
+			wantInfCount: `le="+Inf"} 3`,
+		},
+		{
+			name:         "value above all buckets only counts in +Inf",
+			values:       []float64{10},
+			wantCounts:   []string{`le="1"} 0`, `le="2"} 0`, `le="5"} 0`},
+			wantSum:      "turn_x_sum 10\n",
+			wantCount:    "turn_x_count 1\n",
+			wantInfCount: `le="+Inf"} 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := histogramText("turn_x", tt.values, buckets)
+
+			for _, frag := range tt.wantCounts {
+				if !strings.Contains(out, frag) {
+					t.Errorf("output missing %q in:\n%s", frag, out)
+				}
+			}
+			if !strings.Contains(out, tt.wantInfCount) {
+				t.Errorf("output missing +Inf bucket %q in:\n%s", tt.wantInfCount, out)
+			}
+			if !strings.Contains(out, tt.wantSum) {
+				t.Errorf("output missing sum %q in:\n%s", tt.wantSum, out)
+			}
+			if !strings.Contains(out, tt.wantCount) {
+				t.Errorf("output missing count %q in:\n%s", tt.wantCount, out)
+			}
+		})
+	}
+}
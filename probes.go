@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+// Prober builds one kind of TURN/STUN amplification probe and classifies
+// the response it gets back.
+type Prober interface {
+	// Build sets the method and attributes of m, which already carries a
+	// transaction ID; Fingerprint is added by the caller afterwards.
+	Build(m *stun.Message) error
+	// Classify summarizes a response for display, e.g. "success" or
+	// "error 401".
+	Classify(resp *stun.Message) string
+}
+
+// classifyingProbe implements Classify the same way for every probe that
+// only cares whether the server accepted or rejected the request; probes
+// that need a different classification embed this and override Classify.
+type classifyingProbe struct{}
+
+func (classifyingProbe) Classify(resp *stun.Message) string {
+	if resp.Type.Class == stun.ClassErrorResponse {
+		return fmt.Sprintf("error %d", getErrorCode(resp))
+	}
+	return "success"
+}
+
+// AllocateUDPProbe sends a plain Allocate request for a UDP relay. This is
+// the original, unauthenticated probe the tool always sent.
+type AllocateUDPProbe struct{ classifyingProbe }
+
+func (AllocateUDPProbe) Build(m *stun.Message) error {
+	if err := stun.NewType(stun.MethodAllocate, stun.ClassRequest).AddTo(m); err != nil {
+		return err
+	}
+	return RequestedTransport{Protocol: ProtoUDP}.AddTo(m)
+}
+
+// AllocateTCPProbe requests a TCP relay (RFC 6062) via
+// REQUESTED-TRANSPORT=6, which some servers reject but still answer with a
+// sizeable error response.
+type AllocateTCPProbe struct{ classifyingProbe }
+
+func (AllocateTCPProbe) Build(m *stun.Message) error {
+	if err := stun.NewType(stun.MethodAllocate, stun.ClassRequest).AddTo(m); err != nil {
+		return err
+	}
+	return RequestedTransport{Protocol: ProtoTCP}.AddTo(m)
+}
+
+// BindingProbe sends a classic STUN Binding request with no TURN attributes
+// at all, as a baseline for how much a bare STUN exchange amplifies.
+type BindingProbe struct{ classifyingProbe }
+
+func (BindingProbe) Build(m *stun.Message) error {
+	return stun.NewType(stun.MethodBinding, stun.ClassRequest).AddTo(m)
+}
+
+// AllocateDontFragmentProbe adds DONT-FRAGMENT to an Allocate request for a
+// UDP relay.
+type AllocateDontFragmentProbe struct{ classifyingProbe }
+
+func (AllocateDontFragmentProbe) Build(m *stun.Message) error {
+	if err := stun.NewType(stun.MethodAllocate, stun.ClassRequest).AddTo(m); err != nil {
+		return err
+	}
+	if err := (RequestedTransport{Protocol: ProtoUDP}).AddTo(m); err != nil {
+		return err
+	}
+	return DontFragment{}.AddTo(m)
+}
+
+// AllocateReservationTokenProbe sends RESERVATION-TOKEN on an Allocate
+// request. The token is never a real one from a prior allocation, so the
+// point is to see how the server's validation path responds, not to
+// actually reserve a port.
+type AllocateReservationTokenProbe struct{ classifyingProbe }
+
+func (AllocateReservationTokenProbe) Build(m *stun.Message) error {
+	if err := stun.NewType(stun.MethodAllocate, stun.ClassRequest).AddTo(m); err != nil {
+		return err
+	}
+	return ReservationToken{}.AddTo(m)
+}
+
+// AllocateEvenPortProbe adds EVEN-PORT to an Allocate request.
+type AllocateEvenPortProbe struct{ classifyingProbe }
+
+func (AllocateEvenPortProbe) Build(m *stun.Message) error {
+	if err := stun.NewType(stun.MethodAllocate, stun.ClassRequest).AddTo(m); err != nil {
+		return err
+	}
+	if err := (RequestedTransport{Protocol: ProtoUDP}).AddTo(m); err != nil {
+		return err
+	}
+	return EvenPort{}.AddTo(m)
+}
+
+// unknownPaddingAttr is a STUN attribute type in the comprehension-optional
+// range (0x8000-0xFFFF) that no server should recognize.
+const unknownPaddingAttr = stun.AttrType(0xFF00)
+
+// paddingSize is large enough to move the amplification factor without
+// exceeding typical UDP MTU on its own.
+const paddingSize = 500
+
+// AllocateWithPaddingProbe appends a large unknown comprehension-optional
+// attribute to an Allocate request to check whether the server echoes
+// unknown attributes back, a known amplification vector.
+type AllocateWithPaddingProbe struct{ classifyingProbe }
+
+func (AllocateWithPaddingProbe) Build(m *stun.Message) error {
+	if err := stun.NewType(stun.MethodAllocate, stun.ClassRequest).AddTo(m); err != nil {
+		return err
+	}
+	if err := (RequestedTransport{Protocol: ProtoUDP}).AddTo(m); err != nil {
+		return err
+	}
+	m.Add(unknownPaddingAttr, make([]byte, paddingSize))
+	return nil
+}
+
+// probeRegistry maps the -probe flag's names to their implementations.
+var probeRegistry = map[string]Prober{
+	"allocate-udp":               AllocateUDPProbe{},
+	"allocate-tcp":               AllocateTCPProbe{},
+	"binding":                    BindingProbe{},
+	"allocate-dont-fragment":     AllocateDontFragmentProbe{},
+	"allocate-reservation-token": AllocateReservationTokenProbe{},
+	"allocate-even-port":         AllocateEvenPortProbe{},
+	"allocate-padding":           AllocateWithPaddingProbe{},
+}
+
+// probeNames returns the registered probe names, sorted, for use in flag
+// help text and error messages.
+func probeNames() []string {
+	names := make([]string, 0, len(probeRegistry))
+	for name := range probeRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedProbe pairs a Prober with the name it was selected under, so results
+// can be tagged and grouped by that name in the output.
+type namedProbe struct {
+	Name   string
+	Prober Prober
+}
+
+// parseProbes resolves a comma-separated -probe flag value into the probes
+// to run, preserving the order the user listed them in.
+func parseProbes(spec string) ([]namedProbe, error) {
+	var out []namedProbe
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p, ok := probeRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown probe %q (available: %s)", name, strings.Join(probeNames(), ", "))
+		}
+		out = append(out, namedProbe{Name: name, Prober: p})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no probes selected")
+	}
+	return out, nil
+}
+
+// runProbe builds and sends a single probe request, measuring its
+// request/response sizes, amplification factor and latency. timeout bounds
+// the wait for a response, so an unresponsive target is reported as a
+// timeout rather than blocking forever.
+func runProbe(conn net.PacketConn, to net.Addr, p Prober, timeout time.Duration) (AmplificationResult, error) {
+	var result AmplificationResult
+
+	msg := new(stun.Message)
+	if err := stun.TransactionID.AddTo(msg); err != nil {
+		return result, fmt.Errorf("failed to set transaction ID: %w", err)
+	}
+	if err := p.Build(msg); err != nil {
+		return result, fmt.Errorf("failed to build probe request: %w", err)
+	}
+	if err := stun.Fingerprint.AddTo(msg); err != nil {
+		return result, fmt.Errorf("failed to add fingerprint: %w", err)
+	}
+
+	result.RequestSize = stunHeaderSize + msg.Length
+
+	if _, err := conn.WriteTo(msg.Raw, to); err != nil {
+		return AmplificationResult{}, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return AmplificationResult{}, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	res := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(res)
+	if err != nil {
+		return AmplificationResult{}, err
+	}
+
+	respMsg := stun.New()
+	if err := stun.Decode(res[:n], respMsg); err != nil {
+		return AmplificationResult{}, err
+	}
+
+	result.ResponseSize = stunHeaderSize + respMsg.Length
+	result.AmplificationFactor = float64(result.ResponseSize) / float64(result.RequestSize)
+	result.ResponseType = p.Classify(respMsg)
+
+	var nonce stun.Nonce
+	if err := nonce.GetFrom(respMsg); err == nil {
+		result.HasNonce = true
+		result.NonceSize = len(nonce)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// FailureMode classifies why a probe produced no AmplificationResult.
+type FailureMode string
+
+const (
+	FailureTimeout     FailureMode = "timeout"
+	FailureUnreachable FailureMode = "unreachable"
+	FailureMalformed   FailureMode = "malformed"
+	FailureOther       FailureMode = "error"
+)
+
+// classifyFailure maps an error from dialing or probing a server onto a
+// FailureMode.
+func classifyFailure(err error) FailureMode {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return FailureTimeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		if errors.Is(opErr.Err, syscall.ECONNREFUSED) ||
+			errors.Is(opErr.Err, syscall.EHOSTUNREACH) ||
+			errors.Is(opErr.Err, syscall.ENETUNREACH) {
+			return FailureUnreachable
+		}
+	}
+
+	if strings.Contains(err.Error(), "decode") || strings.Contains(err.Error(), "unexpected response") {
+		return FailureMalformed
+	}
+
+	return FailureOther
+}
+
+// TargetSpec is one line of a -targets file: a server address and the
+// transport to reach it over.
+type TargetSpec struct {
+	Server    string    `json:"server"`
+	Transport Transport `json:"transport"`
+}
+
+// parseTargetsFile reads a -targets file: one "host:port" per line,
+// optionally followed by "proto=udp|tcp|tls" (defaulting to udp). Blank
+// lines and lines starting with '#' are ignored.
+func parseTargetsFile(path string) ([]TargetSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open targets file: %w", err)
+	}
+	defer f.Close()
+
+	var specs []TargetSpec
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		spec := TargetSpec{Server: fields[0], Transport: TransportUDP}
+		for _, field := range fields[1:] {
+			if proto, ok := strings.CutPrefix(field, "proto="); ok {
+				spec.Transport = Transport(proto)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no targets found in %s", path)
+	}
+
+	return specs, nil
+}
+
+// TargetSummary is the per-target outcome of a multi-target scan: the same
+// aggregate numbers printResults shows for a single server, plus the
+// explicit failure-mode breakdown. Err is kept unexported from JSON since
+// error doesn't implement json.Marshaler; ErrorMsg carries the same
+// information for -output json.
+type TargetSummary struct {
+	Target             TargetSpec          `json:"target"`
+	SuccessfulRequests int                 `json:"successful_requests"`
+	AttemptedRequests  int                 `json:"attempted_requests"`
+	AvgAmplification   float64             `json:"avg_amplification_factor"`
+	AvgResponseSize    float64             `json:"avg_response_size_bytes"`
+	Failures           map[FailureMode]int `json:"failures,omitempty"`
+	Err                error               `json:"-"`
+	ErrorMsg           string              `json:"error,omitempty"`
+}
+
+// runTargetScan reads cfg.Targets and probes every target in parallel,
+// bounded by cfg.TargetConcurrency, then prints a per-target summary table
+// and a leaderboard sorted by average amplification factor.
+func runTargetScan(cfg Config) error {
+	specs, err := parseTargetsFile(cfg.Targets)
+	if err != nil {
+		return err
+	}
+
+	concurrency := cfg.TargetConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg        sync.WaitGroup
+		sem       = make(chan struct{}, concurrency)
+		mu        sync.Mutex
+		summaries = make([]TargetSummary, len(specs))
+	)
+
+	for i, spec := range specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, spec TargetSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			targetCfg := cfg
+			targetCfg.Server = spec.Server
+			targetCfg.Transport = spec.Transport
+
+			results, _, attempted, _, failures, err := measureAmplificationFactor(targetCfg)
+
+			summary := TargetSummary{
+				Target:            spec,
+				AttemptedRequests: attempted,
+				Failures:          failures,
+				Err:               err,
+			}
+			if err != nil {
+				summary.ErrorMsg = err.Error()
+			}
+			if len(results) > 0 {
+				var totalAmp float64
+				var totalRespSize uint32
+				for _, res := range results {
+					totalAmp += res.AmplificationFactor
+					totalRespSize += res.ResponseSize
+				}
+				summary.SuccessfulRequests = len(results)
+				summary.AvgAmplification = totalAmp / float64(len(results))
+				summary.AvgResponseSize = float64(totalRespSize) / float64(len(results))
+			}
+
+			mu.Lock()
+			summaries[i] = summary
+			mu.Unlock()
+		}(i, spec)
+	}
+
+	wg.Wait()
+
+	return writeTargetResults(cfg, summaries)
+}
+
+// writeTargetResults renders the scan's per-target summaries in whichever
+// format -output selected, mirroring the text/json/prom modes
+// measureAmplificationFactor's single-server results already support.
+func writeTargetResults(cfg Config, summaries []TargetSummary) error {
+	switch cfg.Output {
+	case "json":
+		return writeTargetJSONResults(os.Stdout, summaries)
+	case "prom":
+		return writeTargetPromOutput(cfg, summaries)
+	default:
+		printTargetSummaries(summaries)
+		printLeaderboard(summaries)
+		return nil
+	}
+}
+
+// leaderboardEntry is one ranked row of the amplification leaderboard.
+type leaderboardEntry struct {
+	Rank               int     `json:"rank"`
+	Target             string  `json:"target"`
+	AvgAmplification   float64 `json:"avg_amplification_factor"`
+	SuccessfulRequests int     `json:"successful_requests"`
+}
+
+// rankedLeaderboard returns the targets with at least one successful
+// result, sorted by descending average amplification factor, shared by the
+// text and JSON renderers.
+func rankedLeaderboard(summaries []TargetSummary) []TargetSummary {
+	leaderboard := make([]TargetSummary, 0, len(summaries))
+	for _, s := range summaries {
+		if s.SuccessfulRequests > 0 {
+			leaderboard = append(leaderboard, s)
+		}
+	}
+
+	sort.Slice(leaderboard, func(i, j int) bool {
+		return leaderboard[i].AvgAmplification > leaderboard[j].AvgAmplification
+	})
+
+	return leaderboard
+}
+
+// writeTargetJSONResults prints one TargetSummary object per line followed
+// by a trailing leaderboard object, the same per-line-plus-summary shape
+// writeJSONResults uses for a single server.
+func writeTargetJSONResults(w io.Writer, summaries []TargetSummary) error {
+	enc := json.NewEncoder(w)
+
+	for _, s := range summaries {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]leaderboardEntry, 0, len(summaries))
+	for rank, s := range rankedLeaderboard(summaries) {
+		entries = append(entries, leaderboardEntry{
+			Rank:               rank + 1,
+			Target:             s.Target.Server,
+			AvgAmplification:   s.AvgAmplification,
+			SuccessfulRequests: s.SuccessfulRequests,
+		})
+	}
+
+	return enc.Encode(struct {
+		Leaderboard []leaderboardEntry `json:"leaderboard"`
+	}{Leaderboard: entries})
+}
+
+// writeTargetPromOutput renders the scan as a Prometheus text-exposition
+// payload and dispatches it the same way writePromOutput does.
+func writeTargetPromOutput(cfg Config, summaries []TargetSummary) error {
+	body := buildTargetPromText(summaries)
+
+	switch {
+	case cfg.MetricsAddr != "":
+		http.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			_, _ = w.Write(body)
+		})
+		fmt.Printf("Serving Prometheus metrics on http://%s/metrics\n", cfg.MetricsAddr)
+		return http.ListenAndServe(cfg.MetricsAddr, nil)
+
+	case cfg.OutputFile != "":
+		return os.WriteFile(cfg.OutputFile, body, 0o644)
+
+	default:
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+}
+
+// buildTargetPromText renders turn_target_amplification_factor and
+// turn_target_response_size_bytes gauges plus turn_target_request_total
+// counters, each labelled by target and transport.
+func buildTargetPromText(summaries []TargetSummary) []byte {
+	var b []byte
+	buf := func(format string, args ...any) {
+		b = append(b, []byte(fmt.Sprintf(format, args...))...)
+	}
+
+	buf("# HELP turn_target_amplification_factor Average response-to-request size ratio per target.\n")
+	buf("# TYPE turn_target_amplification_factor gauge\n")
+	for _, s := range summaries {
+		if s.SuccessfulRequests > 0 {
+			buf("turn_target_amplification_factor{target=%q,transport=%q} %g\n", s.Target.Server, s.Target.Transport, s.AvgAmplification)
+		}
+	}
+
+	buf("# HELP turn_target_response_size_bytes Average TURN response size in bytes per target.\n")
+	buf("# TYPE turn_target_response_size_bytes gauge\n")
+	for _, s := range summaries {
+		if s.SuccessfulRequests > 0 {
+			buf("turn_target_response_size_bytes{target=%q,transport=%q} %g\n", s.Target.Server, s.Target.Transport, s.AvgResponseSize)
+		}
+	}
+
+	buf("# HELP turn_target_request_total Total number of TURN probe requests sent per target.\n")
+	buf("# TYPE turn_target_request_total counter\n")
+	for _, s := range summaries {
+		buf("turn_target_request_total{target=%q,transport=%q,status=\"success\"} %d\n", s.Target.Server, s.Target.Transport, s.SuccessfulRequests)
+		buf("turn_target_request_total{target=%q,transport=%q,status=\"failure\"} %d\n", s.Target.Server, s.Target.Transport, s.AttemptedRequests-s.SuccessfulRequests)
+	}
+
+	return b
+}
+
+// printTargetSummaries prints one row per target in the order the targets
+// file listed them.
+func printTargetSummaries(summaries []TargetSummary) {
+	fmt.Printf("\nPer-Target Summary\n")
+	fmt.Printf("==================\n")
+	fmt.Printf("%-28s %-6s %10s %10s %14s %s\n", "Target", "Proto", "OK", "Attempted", "Amplification", "Failures")
+
+	for _, s := range summaries {
+		if s.Err != nil {
+			fmt.Printf("%-28s %-6s %10s %10d %14s %s\n", s.Target.Server, s.Target.Transport, "-", s.AttemptedRequests, "-", s.Err)
+			continue
+		}
+
+		fmt.Printf("%-28s %-6s %10d %10d %13.2fx %s\n",
+			s.Target.Server, s.Target.Transport, s.SuccessfulRequests, s.AttemptedRequests, s.AvgAmplification, formatFailures(s.Failures))
+	}
+}
+
+// printLeaderboard prints the targets with at least one successful result,
+// sorted by descending average amplification factor, so operators can spot
+// the worst offenders in a fleet at a glance.
+func printLeaderboard(summaries []TargetSummary) {
+	leaderboard := rankedLeaderboard(summaries)
+	if len(leaderboard) == 0 {
+		return
+	}
+
+	fmt.Printf("\nLeaderboard (by average amplification)\n")
+	fmt.Printf("=======================================\n")
+	for rank, s := range leaderboard {
+		fmt.Printf("%2d. %-28s %.2fx (%d samples)\n", rank+1, s.Target.Server, s.AvgAmplification, s.SuccessfulRequests)
+	}
+}
+
+func formatFailures(failures map[FailureMode]int) string {
+	if len(failures) == 0 {
+		return "-"
+	}
+
+	modes := make([]string, 0, len(failures))
+	for mode := range failures {
+		modes = append(modes, string(mode))
+	}
+	sort.Strings(modes)
+
+	parts := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		parts = append(parts, fmt.Sprintf("%s=%d", mode, failures[FailureMode(mode)]))
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Transport selects the underlying network transport used to reach the
+// TURN server. TURN is defined over UDP, TCP and TLS-over-TCP (RFC 6062
+// adds TCP relays, but the control channel itself already supports all
+// three).
+type Transport string
+
+const (
+	TransportUDP Transport = "udp"
+	TransportTCP Transport = "tcp"
+	TransportTLS Transport = "tls"
+)
+
+// dialTransport opens a connection to serverAddr over the requested
+// transport and returns it as a net.PacketConn so that callers written
+// against sendAllocateRequest's UDP-shaped API keep working unchanged.
+func dialTransport(transport Transport, serverAddr string) (net.PacketConn, net.Addr, error) {
+	switch transport {
+	case "", TransportUDP:
+		addr, err := net.ResolveUDPAddr("udp", serverAddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve server address: %w", err)
+		}
+
+		// TURN client won't create a local listening socket by itself.
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to listen: %w", err)
+		}
+
+		return conn, addr, nil
+
+	case TransportTCP:
+		conn, err := net.Dial("tcp", serverAddr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to dial %s: %w", serverAddr, err)
+		}
+
+		return &streamPacketConn{Conn: conn}, conn.RemoteAddr(), nil
+
+	case TransportTLS:
+		conn, err := tls.Dial("tcp", serverAddr, &tls.Config{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to dial %s: %w", serverAddr, err)
+		}
+
+		return &streamPacketConn{Conn: conn}, conn.RemoteAddr(), nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported transport: %q", transport)
+	}
+}
+
+// streamPacketConn adapts a stream-oriented net.Conn (TCP or TLS) to the
+// net.PacketConn interface used throughout this tool. Unlike UDP, a
+// stream has no datagram boundaries, so ReadFrom must frame each STUN
+// message itself: it first reads the fixed 20-byte STUN header, then
+// uses the 2-byte Message Length field at offset 2 to know how many
+// further bytes belong to the same message.
+type streamPacketConn struct {
+	net.Conn
+}
+
+func (s *streamPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return s.Conn.Write(b)
+}
+
+func (s *streamPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	header := make([]byte, stunHeaderSize)
+	if _, err := io.ReadFull(s.Conn, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[2:4]))
+	total := stunHeaderSize + length
+	if total > len(b) {
+		return 0, nil, fmt.Errorf("response too large for buffer: %d bytes", total)
+	}
+
+	copy(b, header)
+	if length > 0 {
+		if _, err := io.ReadFull(s.Conn, b[stunHeaderSize:total]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return total, s.Conn.RemoteAddr(), nil
+}
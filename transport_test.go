@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// stunFrame builds a minimal STUN-shaped header+body: a 20-byte header with
+// the message-length field set to len(body), followed by body itself.
+func stunFrame(body []byte) []byte {
+	header := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(body)))
+	return append(header, body...)
+}
+
+func TestStreamPacketConnReadFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []byte
+		bufSize int
+		wantN   int
+		wantErr bool
+	}{
+		{"zero-length body", nil, 64, stunHeaderSize, false},
+		{"body present", []byte("hello"), 64, stunHeaderSize + 5, false},
+		{"buffer too small for framed message", []byte("hello"), stunHeaderSize, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			frame := stunFrame(tt.body)
+			go func() {
+				_, _ = client.Write(frame)
+			}()
+
+			spc := &streamPacketConn{Conn: server}
+			buf := make([]byte, tt.bufSize)
+			n, _, err := spc.ReadFrom(buf)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ReadFrom() err = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadFrom() unexpected error: %v", err)
+			}
+			if n != tt.wantN {
+				t.Errorf("ReadFrom() n = %d, want %d", n, tt.wantN)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+// This file collects the TURN-specific (RFC 5766/8656) STUN attributes the
+// tool needs to build. pion/stun only ships encode/decode helpers for core
+// STUN (RFC 5389) attributes, so TURN attributes are added by hand in the
+// same style as RequestedTransport above.
+
+// Lifetime is the TURN LIFETIME attribute, a 32-bit unsigned value in
+// seconds.
+type Lifetime struct {
+	Duration time.Duration
+}
+
+const lifetimeSize = 4
+
+// AddTo adds LIFETIME to message.
+func (l Lifetime) AddTo(m *stun.Message) error {
+	v := make([]byte, lifetimeSize)
+	binary.BigEndian.PutUint32(v, uint32(l.Duration.Seconds()))
+	m.Add(stun.AttrLifetime, v)
+
+	return nil
+}
+
+// ChannelNumber is the TURN CHANNEL-NUMBER attribute used by ChannelBind
+// requests.
+type ChannelNumber uint16
+
+const channelNumberSize = 4
+
+// AddTo adds CHANNEL-NUMBER to message.
+func (c ChannelNumber) AddTo(m *stun.Message) error {
+	v := make([]byte, channelNumberSize)
+	binary.BigEndian.PutUint16(v[0:2], uint16(c))
+	// v[2:4] is RFFU = 0.
+	m.Add(stun.AttrChannelNumber, v)
+
+	return nil
+}
+
+// Data is the TURN DATA attribute carried by Send/Data indications.
+type Data []byte
+
+// AddTo adds DATA to message.
+func (d Data) AddTo(m *stun.Message) error {
+	m.Add(stun.AttrData, d)
+	return nil
+}
+
+// peerAddress builds an XOR-PEER-ADDRESS attribute. It reuses pion/stun's
+// XOR-MAPPED-ADDRESS codec since both attributes share the same wire
+// encoding and only differ in attribute type.
+func peerAddress(ip net.IP, port int) stun.Setter {
+	return xorAddressAs{XORMappedAddress: stun.XORMappedAddress{IP: ip, Port: port}, attr: stun.AttrXORPeerAddress}
+}
+
+type xorAddressAs struct {
+	stun.XORMappedAddress
+	attr stun.AttrType
+}
+
+func (x xorAddressAs) AddTo(m *stun.Message) error {
+	return x.XORMappedAddress.AddToAs(m, x.attr)
+}
+
+// DontFragment is the TURN DONT-FRAGMENT attribute, a zero-length
+// comprehension-required attribute.
+type DontFragment struct{}
+
+// AddTo adds DONT-FRAGMENT to message.
+func (DontFragment) AddTo(m *stun.Message) error {
+	m.Add(stun.AttrDontFragment, []byte{})
+	return nil
+}
+
+// ReservationToken is the TURN RESERVATION-TOKEN attribute, an 8-byte
+// opaque token.
+type ReservationToken [8]byte
+
+// AddTo adds RESERVATION-TOKEN to message.
+func (r ReservationToken) AddTo(m *stun.Message) error {
+	m.Add(stun.AttrReservationToken, r[:])
+	return nil
+}
+
+// EvenPort is the TURN EVEN-PORT attribute. ReserveNextHigher requests
+// that the server also reserve the next higher port number.
+type EvenPort struct {
+	ReserveNextHigher bool
+}
+
+// AddTo adds EVEN-PORT to message.
+func (e EvenPort) AddTo(m *stun.Message) error {
+	var flags byte
+	if e.ReserveNextHigher {
+		flags |= 0x80
+	}
+	m.Add(stun.AttrEvenPort, []byte{flags})
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+// StepResult captures the amplification data for a single message exchange
+// within a multi-step TURN dialog.
+type StepResult struct {
+	Step                string        `json:"step"`
+	RequestSize         uint32        `json:"request_size"`
+	ResponseSize        uint32        `json:"response_size"`
+	AmplificationFactor float64       `json:"amplification_factor"`
+	Latency             time.Duration `json:"latency_ns"`
+	Success             bool          `json:"success"`
+}
+
+// runAuthenticatedRequest drives the full RFC 5766 long-term credential
+// Allocate dialog and folds it into an AmplificationResult: the top-level
+// fields mirror the initial unauthenticated Allocate (so it keeps composing
+// with the existing overall statistics) while Steps holds the full
+// per-stage breakdown.
+func runAuthenticatedRequest(conn net.PacketConn, to net.Addr, user, pass, realm string, timeout time.Duration) (AmplificationResult, error) {
+	steps, err := runAuthenticatedFlow(conn, to, user, pass, realm, timeout)
+	if len(steps) == 0 {
+		return AmplificationResult{}, err
+	}
+
+	first := steps[0]
+
+	return AmplificationResult{
+		RequestSize:         first.RequestSize,
+		ResponseSize:        first.ResponseSize,
+		AmplificationFactor: first.AmplificationFactor,
+		Steps:               steps,
+	}, err
+}
+
+// runAuthenticatedFlow performs the full TURN allocation lifecycle: the
+// unauthenticated Allocate that elicits the REALM/NONCE challenge, the
+// authenticated Allocate, CreatePermission, a Send indication, ChannelBind
+// and finally Refresh.
+func runAuthenticatedFlow(conn net.PacketConn, to net.Addr, user, pass, realm string, timeout time.Duration) ([]StepResult, error) {
+	var steps []StepResult
+
+	step1, resp1, err := probeStep(conn, to, timeout, "Allocate (unauth)", stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		RequestedTransport{Protocol: ProtoUDP},
+	)
+	if err != nil {
+		return steps, err
+	}
+	steps = append(steps, step1)
+
+	var nonce stun.Nonce
+	if err := nonce.GetFrom(resp1); err != nil {
+		return steps, fmt.Errorf("server did not challenge with a NONCE: %w", err)
+	}
+
+	// -realm wins when the caller set it explicitly; otherwise fall back to
+	// whatever realm the server challenged with.
+	serverRealm := realm
+	if serverRealm == "" {
+		var realmAttr stun.Realm
+		if err := realmAttr.GetFrom(resp1); err == nil {
+			serverRealm = string(realmAttr)
+		}
+	}
+
+	integrity := stun.NewLongTermIntegrity(user, serverRealm, pass)
+	credentials := []stun.Setter{stun.NewUsername(user), stun.NewRealm(serverRealm), nonce, integrity}
+
+	step2, resp2, err := probeStep(conn, to, timeout, "Allocate (auth)", stun.NewType(stun.MethodAllocate, stun.ClassRequest),
+		append([]stun.Setter{RequestedTransport{Protocol: ProtoUDP}}, credentials...)...,
+	)
+	if err != nil {
+		return steps, err
+	}
+	steps = append(steps, step2)
+
+	if !step2.Success {
+		return steps, fmt.Errorf("authenticated allocate failed: %v", getErrorCode(resp2))
+	}
+
+	var relayed stun.XORMappedAddress
+	if err := relayed.GetFromAs(resp2, stun.AttrXORRelayedAddress); err != nil {
+		return steps, fmt.Errorf("allocate response missing XOR-RELAYED-ADDRESS: %w", err)
+	}
+
+	// CreatePermission/Send/ChannelBind only need a peer address to probe
+	// amplification; a fixed example-range address is good enough since
+	// the tool never relays real traffic to it.
+	peer := net.IPv4(203, 0, 113, 1)
+	const peerPort = 9
+
+	step3, _, err := probeStep(conn, to, timeout, "CreatePermission", stun.NewType(stun.MethodCreatePermission, stun.ClassRequest),
+		append([]stun.Setter{peerAddress(peer, peerPort)}, credentials...)...,
+	)
+	if err != nil {
+		return steps, err
+	}
+	steps = append(steps, step3)
+
+	step4, err := sendIndication(conn, to, peer, peerPort)
+	if err != nil {
+		return steps, err
+	}
+	steps = append(steps, step4)
+
+	step5, _, err := probeStep(conn, to, timeout, "ChannelBind", stun.NewType(stun.MethodChannelBind, stun.ClassRequest),
+		append([]stun.Setter{ChannelNumber(0x4000), peerAddress(peer, peerPort)}, credentials...)...,
+	)
+	if err != nil {
+		return steps, err
+	}
+	steps = append(steps, step5)
+
+	step6, _, err := probeStep(conn, to, timeout, "Refresh", stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+		append([]stun.Setter{Lifetime{Duration: 600 * time.Second}}, credentials...)...,
+	)
+	if err != nil {
+		return steps, err
+	}
+	steps = append(steps, step6)
+
+	return steps, nil
+}
+
+// probeStep builds and sends a single STUN/TURN request, measuring its
+// request/response sizes, amplification factor and latency.
+func probeStep(conn net.PacketConn, to net.Addr, timeout time.Duration, name string, msgType stun.MessageType, setters ...stun.Setter) (StepResult, *stun.Message, error) {
+	all := append([]stun.Setter{stun.TransactionID, msgType}, setters...)
+	all = append(all, stun.Fingerprint)
+
+	msg, err := stun.Build(all...)
+	if err != nil {
+		return StepResult{Step: name}, nil, fmt.Errorf("failed to build %s request: %w", name, err)
+	}
+
+	reqSize := stunHeaderSize + msg.Length
+
+	start := time.Now()
+	if _, err := conn.WriteTo(msg.Raw, to); err != nil {
+		return StepResult{Step: name}, nil, fmt.Errorf("failed to send %s request: %w", name, err)
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return StepResult{Step: name}, nil, fmt.Errorf("failed to set deadline for %s: %w", name, err)
+	}
+
+	res := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(res)
+	latency := time.Since(start)
+	if err != nil {
+		return StepResult{Step: name}, nil, fmt.Errorf("failed to read %s response: %w", name, err)
+	}
+
+	respMsg := stun.New()
+	if err := stun.Decode(res[:n], respMsg); err != nil {
+		return StepResult{Step: name}, nil, fmt.Errorf("failed to decode %s response: %w", name, err)
+	}
+
+	respSize := stunHeaderSize + respMsg.Length
+
+	return StepResult{
+		Step:                name,
+		RequestSize:         reqSize,
+		ResponseSize:        respSize,
+		AmplificationFactor: float64(respSize) / float64(reqSize),
+		Latency:             latency,
+		Success:             respMsg.Type.Class != stun.ClassErrorResponse,
+	}, respMsg, nil
+}
+
+// sendIndication sends a Send indication carrying a small probe payload.
+// Indications get no reply, so only the request side can be measured.
+func sendIndication(conn net.PacketConn, to net.Addr, peer net.IP, peerPort int) (StepResult, error) {
+	const name = "Send indication"
+
+	msg, err := stun.Build(
+		stun.TransactionID,
+		stun.NewType(stun.MethodSend, stun.ClassIndication),
+		peerAddress(peer, peerPort),
+		Data("turn-amplification-tool probe"),
+		stun.Fingerprint,
+	)
+	if err != nil {
+		return StepResult{Step: name}, fmt.Errorf("failed to build %s: %w", name, err)
+	}
+
+	reqSize := stunHeaderSize + msg.Length
+
+	start := time.Now()
+	if _, err := conn.WriteTo(msg.Raw, to); err != nil {
+		return StepResult{Step: name}, fmt.Errorf("failed to send %s: %w", name, err)
+	}
+
+	return StepResult{
+		Step:        name,
+		RequestSize: reqSize,
+		Latency:     time.Since(start),
+		Success:     true,
+	}, nil
+}